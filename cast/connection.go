@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -22,90 +24,422 @@ import (
 const (
 	dialerTimeout   = time.Second * 30
 	dialerKeepAlive = time.Second * 30
-)
 
-var (
-	// Global request id
-	requestID int
+	// sendQueueSize bounds how many outstanding writes can be queued for the
+	// single sender goroutine before Send/SendAndWait callers block.
+	sendQueueSize = 32
+
+	// defaultKeepaliveInterval is how often a PING is proactively sent on
+	// each connected destination's heartbeat channel.
+	defaultKeepaliveInterval = 30 * time.Second
+
+	// reconnectBackoffStart/Cap bound the exponential backoff used between
+	// reconnect attempts once the socket drops.
+	reconnectBackoffStart = time.Second
+	reconnectBackoffCap   = 32 * time.Second
+
+	namespaceConnection = "urn:x-cast:com.google.cast.tp.connection"
+	namespaceHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	namespaceReceiver   = "urn:x-cast:com.google.cast.receiver"
+	namespaceMedia      = "urn:x-cast:com.google.cast.media"
+
+	// listenerQueueSize bounds each listener's event queue; once full,
+	// publish drops the oldest queued event rather than blocking
+	// receiveLoop on a slow subscriber.
+	listenerQueueSize = 16
 )
 
-type Connection struct {
-	conn *tls.Conn
+// errConnectionClosed is returned by SendAndWait calls still waiting for a
+// reply when the socket drops, and by Send/SendAndWait calls still queued or
+// writing when Close is called.
+var errConnectionClosed = errors.New("cast: connection closed")
 
-	resultChanMap map[int]chan *pb.CastMessage
+type sendRequest struct {
+	data []byte
+	done chan error
+}
 
-	debug     bool
-	connected bool
+type Connection struct {
+	addr string
+	port int
+
+	// requestID is the last allocated request id, mutated only via atomic
+	// operations so concurrent callers can't hand out the same id.
+	requestID int64
+
+	resultChanMapMu sync.RWMutex
+	resultChanMap   map[int]chan *pb.CastMessage
+
+	// sendCh serializes writes onto conn so concurrent callers can't
+	// interleave frames on the same TLS pipe.
+	sendCh chan sendRequest
+
+	// connectedMu/connectedDestinations track every destinationId this
+	// connection has sent CONNECT to, so a reconnect can re-establish each
+	// one (a Chromecast virtual connection is scoped to sourceId+destinationId,
+	// and destinationId is the receiver/app transportId).
+	connectedMu           sync.RWMutex
+	connectedDestinations map[string]string // destinationId -> sourceId
+
+	// stateMu guards conn/connected/disconnectedCh, all of which connect()
+	// and reconnectLoop mutate from a different goroutine than the one
+	// sendLoop/receiveLoop/writeFrame read them from. disconnectedCh is
+	// swapped out on every successful (re)connect and closed on disconnect
+	// so that in-flight SendAndWait calls unblock with errConnectionClosed.
+	stateMu        sync.RWMutex
+	conn           *tls.Conn
+	connected      bool
+	disconnectedCh chan struct{}
+
+	keepaliveInterval time.Duration
+
+	// replayGainMode/replayGainTargetDB configure the default loudness
+	// normalization LoadMedia applies; see replaygain.go.
+	replayGainMode     ReplayGainMode
+	replayGainTargetDB float64
+
+	callbackMu   sync.RWMutex
+	onDisconnect func()
+	onReconnect  func()
+
+	// nextListenerID/listenersMu/listeners back AddListener; see listeners.go.
+	nextListenerID uint64
+	listenersMu    sync.RWMutex
+	listeners      map[uint64]*listenerEntry
+
+	// volumeMu/lastVolume and appsMu/lastApplications let the typed
+	// OnVolumeChanged/OnAppLaunched/OnAppClosed helpers diff successive
+	// RECEIVER_STATUS messages instead of firing on every poll.
+	volumeMu         sync.Mutex
+	lastVolume       *Volume
+	appsMu           sync.Mutex
+	lastApplications map[string]Application
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+
+	debug bool
 }
 
 func NewConnection(debug bool) *Connection {
 	c := &Connection{
-		resultChanMap: map[int]chan *pb.CastMessage{},
-		debug:         debug,
-		connected:     false,
+		resultChanMap:         map[int]chan *pb.CastMessage{},
+		sendCh:                make(chan sendRequest, sendQueueSize),
+		connectedDestinations: map[string]string{},
+		disconnectedCh:        make(chan struct{}),
+		keepaliveInterval:     defaultKeepaliveInterval,
+		replayGainTargetDB:    defaultReplayGainTargetDB,
+		listeners:             map[uint64]*listenerEntry{},
+		lastApplications:      map[string]Application{},
+		closeCh:               make(chan struct{}),
+		debug:                 debug,
 	}
 	return c
 }
 
+// getConn returns the current TLS connection, if any.
+func (c *Connection) getConn() *tls.Conn {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.conn
+}
+
+func (c *Connection) isConnected() bool {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.connected
+}
+
+func (c *Connection) setConnected(v bool) {
+	c.stateMu.Lock()
+	c.connected = v
+	c.stateMu.Unlock()
+}
+
 func (c *Connection) Start(addr string, port int) error {
-	if !c.connected {
-		defer func() { go c.receiveLoop() }()
-		return c.connect(addr, port)
+	if !c.isConnected() {
+		c.addr, c.port = addr, port
+		if err := c.connect(addr, port); err != nil {
+			return err
+		}
+		c.wg.Add(3)
+		go c.receiveLoop()
+		go c.sendLoop()
+		go c.keepaliveLoop()
 	}
 	return nil
 }
 
 func (c *Connection) SetDebug(debug bool) { c.debug = debug }
 
+// SetKeepaliveInterval changes how often a proactive PING is sent on each
+// connected destination's heartbeat channel. Must be called before Start.
+func (c *Connection) SetKeepaliveInterval(interval time.Duration) { c.keepaliveInterval = interval }
+
 func (c *Connection) log(message string, args ...interface{}) {
 	if c.debug {
 		log.Printf("[connection] %s", fmt.Sprintf(message, args...))
 	}
 }
 
+// OnDisconnect registers a callback invoked whenever the socket drops,
+// before a reconnect is attempted.
+func (c *Connection) OnDisconnect(fn func()) {
+	c.callbackMu.Lock()
+	c.onDisconnect = fn
+	c.callbackMu.Unlock()
+}
+
+// OnReconnect registers a callback invoked after a dropped connection has
+// been re-established and all tracked destinations re-CONNECTed.
+func (c *Connection) OnReconnect(fn func()) {
+	c.callbackMu.Lock()
+	c.onReconnect = fn
+	c.callbackMu.Unlock()
+}
+
+// Close tears down the keepalive ticker and reconnect loop, drains any
+// in-flight SendAndWait callers with errConnectionClosed, and closes the
+// underlying socket. It returns early if ctx is done before the background
+// goroutines finish exiting.
+func (c *Connection) Close(ctx context.Context) error {
+	var closeErr error
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+		c.setConnected(false)
+		c.signalDisconnected()
+		c.closeListeners()
+		if conn := c.getConn(); conn != nil {
+			closeErr = conn.Close()
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (c *Connection) connect(addr string, port int) error {
-	var err error
 	dialer := &net.Dialer{
 		Timeout:   dialerTimeout,
 		KeepAlive: dialerKeepAlive,
 	}
-	c.conn, err = tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%s:%d", addr, port), &tls.Config{
+	conn, err := tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%s:%d", addr, port), &tls.Config{
 		InsecureSkipVerify: true,
 	})
 	if err != nil {
 		return errors.Wrapf(err, "unable to connect to chromecast at '%s:%d'", addr, port)
 	}
+
+	c.stateMu.Lock()
+	c.conn = conn
 	c.connected = true
+	c.disconnectedCh = make(chan struct{})
+	c.stateMu.Unlock()
 	return nil
 }
 
-func (c *Connection) SendAndWait(ctx context.Context, payload Payload, sourceID, destinationID, namespace string) (*pb.CastMessage, error) {
+// signalDisconnected closes the current generation's disconnectedCh,
+// unblocking any SendAndWait calls waiting on it, and fires OnDisconnect.
+func (c *Connection) signalDisconnected() {
+	c.stateMu.Lock()
+	select {
+	case <-c.disconnectedCh:
+		// already closed for this generation
+	default:
+		close(c.disconnectedCh)
+	}
+	c.stateMu.Unlock()
+}
 
-	if err := c.Send(payload, sourceID, destinationID, namespace); err != nil {
-		return nil, err
+func (c *Connection) fireDisconnect() {
+	c.callbackMu.RLock()
+	fn := c.onDisconnect
+	c.callbackMu.RUnlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+func (c *Connection) fireReconnect() {
+	c.callbackMu.RLock()
+	fn := c.onReconnect
+	c.callbackMu.RUnlock()
+	if fn != nil {
+		fn()
 	}
+}
+
+// handleDisconnect is called once from receiveLoop when the socket errors
+// out. It drains waiters, fires OnDisconnect, and kicks off a backoff
+// reconnect loop unless the connection was closed deliberately.
+func (c *Connection) handleDisconnect() {
+	select {
+	case <-c.closeCh:
+		return
+	default:
+	}
+
+	c.setConnected(false)
+	c.signalDisconnected()
+	c.fireDisconnect()
+
+	c.wg.Add(1)
+	go c.reconnectLoop()
+}
+
+// reconnectLoop retries c.connect with exponential backoff (capped) until it
+// succeeds or Close is called, then re-sends CONNECT for every destination
+// this connection had previously established, and restarts receiveLoop.
+// sendLoop and keepaliveLoop keep running across reconnects until Close.
+func (c *Connection) reconnectLoop() {
+	defer c.wg.Done()
+
+	backoff := reconnectBackoffStart
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case <-time.After(backoff):
+		}
+
+		if err := c.connect(c.addr, c.port); err != nil {
+			c.log("reconnect attempt failed: %v", err)
+			backoff *= 2
+			if backoff > reconnectBackoffCap {
+				backoff = reconnectBackoffCap
+			}
+			continue
+		}
+
+		c.resubscribe()
+		c.fireReconnect()
+
+		c.wg.Add(1)
+		go c.receiveLoop()
+		return
+	}
+}
+
+// resubscribe re-issues CONNECT for every destinationId tracked before the
+// socket dropped, re-establishing each Chromecast virtual connection.
+func (c *Connection) resubscribe() {
+	c.connectedMu.RLock()
+	destinations := make(map[string]string, len(c.connectedDestinations))
+	for dest, src := range c.connectedDestinations {
+		destinations[dest] = src
+	}
+	c.connectedMu.RUnlock()
+
+	for dest, src := range destinations {
+		// Send mutates the payload's RequestId, so each call needs its own
+		// copy of the shared ConnectHeader rather than a pointer to it --
+		// concurrent senders sharing one package-level var would race on it.
+		header := ConnectHeader
+		if _, err := c.Send(&header, src, dest, namespaceConnection); err != nil {
+			c.log("unable to re-establish connection to %s after reconnect: %v", dest, err)
+		}
+	}
+}
+
+// keepaliveLoop proactively sends PING on the heartbeat namespace for every
+// connected destination, rather than relying solely on PONGing the
+// receiver's PINGs.
+func (c *Connection) keepaliveLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case <-ticker.C:
+			c.connectedMu.RLock()
+			destinations := make(map[string]string, len(c.connectedDestinations))
+			for dest, src := range c.connectedDestinations {
+				destinations[dest] = src
+			}
+			c.connectedMu.RUnlock()
+
+			for dest, src := range destinations {
+				// Same reasoning as resubscribe: don't share PingHeader's
+				// address across concurrent Send calls.
+				header := PingHeader
+				if _, err := c.Send(&header, src, dest, namespaceHeartbeat); err != nil {
+					c.log("unable to send keepalive PING to %s: %v", dest, err)
+				}
+			}
+		}
+	}
+}
+
+// SendAndWait allocates a request id, registers its result channel *before*
+// the frame is written, and returns whatever reply arrives for that id. This
+// ordering is what makes it safe to call concurrently: a reply can never
+// race ahead of the map registration that is supposed to catch it.
+func (c *Connection) SendAndWait(ctx context.Context, payload Payload, sourceID, destinationID, namespace string) (*pb.CastMessage, error) {
+	id := c.nextRequestID()
+	payload.SetRequestId(id)
 
-	// TODO(vishen): find better solution, super hacky, and it relying on
-	// Send() to set the requestID. This is prone to race conditions!
 	resultChan := make(chan *pb.CastMessage, 1)
-	c.resultChanMap[requestID] = resultChan
+	c.resultChanMapMu.Lock()
+	c.resultChanMap[id] = resultChan
+	c.resultChanMapMu.Unlock()
 	defer func() {
-		delete(c.resultChanMap, requestID)
+		c.resultChanMapMu.Lock()
+		delete(c.resultChanMap, id)
+		c.resultChanMapMu.Unlock()
 	}()
 
+	c.stateMu.RLock()
+	disconnected := c.disconnectedCh
+	c.stateMu.RUnlock()
+
+	if err := c.send(id, payload, sourceID, destinationID, namespace); err != nil {
+		return nil, err
+	}
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
+	case <-disconnected:
+		return nil, errConnectionClosed
 	case result := <-resultChan:
 		return result, nil
 	}
 }
 
-func (c *Connection) Send(payload Payload, sourceID, destinationID, namespace string) error {
-	// NOTE: Not concurrent safe, but currently only synchronous flow is possible
-	// TODO(vishen): just make concurrent safe regardless of current flow
-	requestID += 1
-	payload.SetRequestId(requestID)
+// Send allocates a request id, writes the payload, and returns the id that
+// was assigned so callers who need to correlate a later reply themselves can
+// do so.
+func (c *Connection) Send(payload Payload, sourceID, destinationID, namespace string) (int, error) {
+	id := c.nextRequestID()
+	if err := c.send(id, payload, sourceID, destinationID, namespace); err != nil {
+		return id, err
+	}
+	return id, nil
+}
+
+// nextRequestID hands out an id unique within this connection via atomic
+// increment, replacing the old unsynchronized package-level counter.
+func (c *Connection) nextRequestID() int {
+	return int(atomic.AddInt64(&c.requestID, 1))
+}
+
+func (c *Connection) send(id int, payload Payload, sourceID, destinationID, namespace string) error {
+	payload.SetRequestId(id)
 
 	payloadJson, err := json.Marshal(payload)
 	if err != nil {
@@ -128,22 +462,85 @@ func (c *Connection) Send(payload Payload, sourceID, destinationID, namespace st
 
 	c.log("%s -> %s [%s]: %s", sourceID, destinationID, namespace, payloadJson)
 
-	if err := binary.Write(c.conn, binary.BigEndian, uint32(len(data))); err != nil {
+	c.trackConnectionState(payload, sourceID, destinationID)
+
+	done := make(chan error, 1)
+	select {
+	case c.sendCh <- sendRequest{data: data, done: done}:
+	case <-c.closeCh:
+		return errConnectionClosed
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-c.closeCh:
+		return errConnectionClosed
+	}
+}
+
+// trackConnectionState records (or forgets) the destinationId this
+// connection has sent CONNECT/CLOSE to, so a dropped socket knows which
+// virtual connections to re-establish on reconnect.
+func (c *Connection) trackConnectionState(payload Payload, sourceID, destinationID string) {
+	header, ok := payload.(*PayloadHeader)
+	if !ok {
+		return
+	}
+	switch header.Type {
+	case ConnectHeader.Type:
+		c.connectedMu.Lock()
+		c.connectedDestinations[destinationID] = sourceID
+		c.connectedMu.Unlock()
+	case CloseHeader.Type:
+		c.connectedMu.Lock()
+		delete(c.connectedDestinations, destinationID)
+		c.connectedMu.Unlock()
+	}
+}
+
+// sendLoop is the single writer for conn. Funnelling every frame through one
+// goroutine means concurrent callers to Send/SendAndWait can't interleave
+// partial writes on the same TLS pipe; the bounded sendCh queue lets callers
+// issue LOAD/GET_STATUS/SEEK etc. concurrently without stomping on each
+// other.
+func (c *Connection) sendLoop() {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case req := <-c.sendCh:
+			req.done <- c.writeFrame(req.data)
+		}
+	}
+}
+
+func (c *Connection) writeFrame(data []byte) error {
+	conn := c.getConn()
+	if err := binary.Write(conn, binary.BigEndian, uint32(len(data))); err != nil {
 		return errors.Wrap(err, "unable to write binary format")
 	}
-	if _, err := c.conn.Write(data); err != nil {
+	if _, err := conn.Write(data); err != nil {
 		return errors.Wrap(err, "unable to send data")
 	}
-
 	return nil
 }
 
 func (c *Connection) receiveLoop() {
+	defer c.wg.Done()
+
+	// Snapshot the conn for this generation: a new receiveLoop is started
+	// for each reconnect, so this generation's conn never changes for the
+	// lifetime of this loop.
+	conn := c.getConn()
+
 	for {
 		var length uint32
-		if err := binary.Read(c.conn, binary.BigEndian, &length); err != nil {
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
 			c.log("failed to binary read payload: %v", err)
-			break
+			c.handleDisconnect()
+			return
 		}
 		if length == 0 {
 			c.log("empty payload received")
@@ -151,7 +548,7 @@ func (c *Connection) receiveLoop() {
 		}
 
 		payload := make([]byte, length)
-		i, err := io.ReadFull(c.conn, payload)
+		i, err := io.ReadFull(conn, payload)
 		if err != nil {
 			c.log("failed to read payload: %v", err)
 			continue
@@ -181,6 +578,7 @@ func (c *Connection) receiveLoop() {
 }
 
 func (c *Connection) handleMessage(message *pb.CastMessage, headers *PayloadHeader) {
+	c.publish(message, headers)
 
 	messageType, err := jsonparser.GetString([]byte(*message.PayloadUtf8), "type")
 	if err != nil {
@@ -190,7 +588,11 @@ func (c *Connection) handleMessage(message *pb.CastMessage, headers *PayloadHead
 
 	switch messageType {
 	case "PING":
-		if err := c.Send(&PongHeader, *message.SourceId, *message.DestinationId, *message.Namespace); err != nil {
+		// Same reasoning as resubscribe/keepaliveLoop: other Connections
+		// sharing this process could be replying to their own PINGs
+		// concurrently, so don't hand Send a pointer to the shared var.
+		header := PongHeader
+		if _, err := c.Send(&header, *message.SourceId, *message.DestinationId, *message.Namespace); err != nil {
 			c.log("unable to respond to 'PING': %v", err)
 		}
 	default:
@@ -198,7 +600,10 @@ func (c *Connection) handleMessage(message *pb.CastMessage, headers *PayloadHead
 		if err != nil {
 			c.log("unable to find 'requestId' in proto payload '%s': %v", *message.PayloadUtf8, err)
 		}
-		if resultChan, ok := c.resultChanMap[int(requestID)]; ok {
+		c.resultChanMapMu.RLock()
+		resultChan, ok := c.resultChanMap[int(requestID)]
+		c.resultChanMapMu.RUnlock()
+		if ok {
 			resultChan <- message
 		}
 	}
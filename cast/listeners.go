@@ -0,0 +1,219 @@
+package cast
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	pb "github.com/vishen/go-chromecast/cast/proto"
+)
+
+// ListenerHandle identifies a listener registered via AddListener, for
+// later removal via RemoveListener.
+type ListenerHandle uint64
+
+type listenerEvent struct {
+	message *pb.CastMessage
+	header  *PayloadHeader
+}
+
+type listenerEntry struct {
+	namespace string
+	fn        func(message *pb.CastMessage, header *PayloadHeader)
+	ch        chan listenerEvent
+}
+
+// AddListener subscribes fn to every message received on namespace (every
+// namespace if empty), including unsolicited RECEIVER_STATUS/MEDIA_STATUS
+// broadcasts that SendAndWait has no requestId to route. fn runs on its own
+// goroutine fed by a bounded, drop-oldest queue, so a slow listener can't
+// stall receiveLoop. The returned handle removes the listener.
+func (c *Connection) AddListener(namespace string, fn func(message *pb.CastMessage, header *PayloadHeader)) ListenerHandle {
+	id := atomic.AddUint64(&c.nextListenerID, 1)
+	entry := &listenerEntry{
+		namespace: namespace,
+		fn:        fn,
+		ch:        make(chan listenerEvent, listenerQueueSize),
+	}
+
+	c.listenersMu.Lock()
+	c.listeners[id] = entry
+	c.listenersMu.Unlock()
+
+	c.wg.Add(1)
+	go c.dispatchListener(entry)
+
+	return ListenerHandle(id)
+}
+
+// RemoveListener unregisters a listener previously returned by AddListener
+// (or by one of the typed On* helpers). Removing an already-removed or
+// unknown handle is a no-op.
+func (c *Connection) RemoveListener(handle ListenerHandle) {
+	c.listenersMu.Lock()
+	entry, ok := c.listeners[uint64(handle)]
+	if ok {
+		delete(c.listeners, uint64(handle))
+	}
+	c.listenersMu.Unlock()
+
+	if ok {
+		close(entry.ch)
+	}
+}
+
+func (c *Connection) closeListeners() {
+	c.listenersMu.Lock()
+	for id, entry := range c.listeners {
+		close(entry.ch)
+		delete(c.listeners, id)
+	}
+	c.listenersMu.Unlock()
+}
+
+func (c *Connection) dispatchListener(entry *listenerEntry) {
+	defer c.wg.Done()
+	for event := range entry.ch {
+		entry.fn(event.message, event.header)
+	}
+}
+
+// publish fans a received message out to every listener subscribed to its
+// namespace. Delivery is best-effort: a full listener queue has its oldest
+// event dropped to make room, rather than blocking the caller (receiveLoop).
+func (c *Connection) publish(message *pb.CastMessage, header *PayloadHeader) {
+	c.listenersMu.RLock()
+	defer c.listenersMu.RUnlock()
+
+	for _, entry := range c.listeners {
+		if entry.namespace != "" && (message.Namespace == nil || entry.namespace != *message.Namespace) {
+			continue
+		}
+
+		event := listenerEvent{message: message, header: header}
+		select {
+		case entry.ch <- event:
+			continue
+		default:
+		}
+
+		// Queue is full: drop the oldest event to make room, best-effort.
+		select {
+		case <-entry.ch:
+		default:
+		}
+		select {
+		case entry.ch <- event:
+		default:
+		}
+	}
+}
+
+// OnMediaStatus subscribes to MEDIA_STATUS broadcasts on the media
+// namespace, e.g. volume changes or playback state transitions driven by
+// another sender.
+func (c *Connection) OnMediaStatus(fn func(Media)) ListenerHandle {
+	return c.AddListener(namespaceMedia, func(message *pb.CastMessage, header *PayloadHeader) {
+		if header.Type != "MEDIA_STATUS" {
+			return
+		}
+		var resp MediaStatusResponse
+		if err := json.Unmarshal([]byte(*message.PayloadUtf8), &resp); err != nil {
+			c.log("OnMediaStatus: unable to unmarshal status: %v", err)
+			return
+		}
+		for _, status := range resp.Status {
+			fn(status)
+		}
+	})
+}
+
+// OnReceiverStatus subscribes to RECEIVER_STATUS broadcasts on the receiver
+// namespace, e.g. app launches/closes or volume changes driven by another
+// sender.
+func (c *Connection) OnReceiverStatus(fn func(ReceiverStatusResponse)) ListenerHandle {
+	return c.AddListener(namespaceReceiver, func(message *pb.CastMessage, header *PayloadHeader) {
+		if header.Type != "RECEIVER_STATUS" {
+			return
+		}
+		var resp ReceiverStatusResponse
+		if err := json.Unmarshal([]byte(*message.PayloadUtf8), &resp); err != nil {
+			c.log("OnReceiverStatus: unable to unmarshal status: %v", err)
+			return
+		}
+		fn(resp)
+	})
+}
+
+// OnVolumeChanged subscribes to RECEIVER_STATUS and fires fn only when the
+// reported volume differs from the last one observed.
+func (c *Connection) OnVolumeChanged(fn func(Volume)) ListenerHandle {
+	return c.OnReceiverStatus(func(resp ReceiverStatusResponse) {
+		volume := resp.Status.Volume
+
+		c.volumeMu.Lock()
+		changed := c.lastVolume == nil || *c.lastVolume != volume
+		c.lastVolume = &volume
+		c.volumeMu.Unlock()
+
+		if changed {
+			fn(volume)
+		}
+	})
+}
+
+// OnAppLaunched subscribes to RECEIVER_STATUS and fires fn for every
+// application present that wasn't in the previous status.
+func (c *Connection) OnAppLaunched(fn func(Application)) ListenerHandle {
+	return c.OnReceiverStatus(func(resp ReceiverStatusResponse) {
+		for _, app := range c.diffApplications(resp.Status.Applications) {
+			if app.launched {
+				fn(app.Application)
+			}
+		}
+	})
+}
+
+// OnAppClosed subscribes to RECEIVER_STATUS and fires fn for every
+// application present in the previous status but missing from this one.
+func (c *Connection) OnAppClosed(fn func(Application)) ListenerHandle {
+	return c.OnReceiverStatus(func(resp ReceiverStatusResponse) {
+		for _, app := range c.diffApplications(resp.Status.Applications) {
+			if !app.launched {
+				fn(app.Application)
+			}
+		}
+	})
+}
+
+type applicationDiff struct {
+	Application
+	launched bool
+}
+
+// diffApplications compares current against the last-seen application set,
+// updating it, and returns every application that appeared (launched=true)
+// or disappeared (launched=false) since.
+func (c *Connection) diffApplications(current []Application) []applicationDiff {
+	currentByID := make(map[string]Application, len(current))
+	for _, app := range current {
+		currentByID[app.SessionId] = app
+	}
+
+	c.appsMu.Lock()
+	prev := c.lastApplications
+	c.lastApplications = currentByID
+	c.appsMu.Unlock()
+
+	var diffs []applicationDiff
+	for id, app := range currentByID {
+		if _, ok := prev[id]; !ok {
+			diffs = append(diffs, applicationDiff{Application: app, launched: true})
+		}
+	}
+	for id, app := range prev {
+		if _, ok := currentByID[id]; !ok {
+			diffs = append(diffs, applicationDiff{Application: app, launched: false})
+		}
+	}
+	return diffs
+}
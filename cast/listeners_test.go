@@ -0,0 +1,68 @@
+package cast
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestConnectionDiffApplications(t *testing.T) {
+	app1 := Application{AppId: "A1", SessionId: "s1", DisplayName: "App One"}
+	app2 := Application{AppId: "A2", SessionId: "s2", DisplayName: "App Two"}
+	app2Renamed := Application{AppId: "A2", SessionId: "s2", DisplayName: "App Two Renamed"}
+
+	tests := []struct {
+		name    string
+		initial []Application
+		next    []Application
+		want    []applicationDiff
+	}{
+		{
+			name:    "first status launches everything",
+			initial: nil,
+			next:    []Application{app1},
+			want:    []applicationDiff{{Application: app1, launched: true}},
+		},
+		{
+			name:    "new app launched alongside an existing one",
+			initial: []Application{app1},
+			next:    []Application{app1, app2},
+			want:    []applicationDiff{{Application: app2, launched: true}},
+		},
+		{
+			name:    "app closed",
+			initial: []Application{app1, app2},
+			next:    []Application{app1},
+			want:    []applicationDiff{{Application: app2, launched: false}},
+		},
+		{
+			name:    "unchanged set produces no diff",
+			initial: []Application{app1, app2},
+			next:    []Application{app1, app2},
+			want:    nil,
+		},
+		{
+			name:    "fields changing on a tracked session are not a launch",
+			initial: []Application{app2},
+			next:    []Application{app2Renamed},
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConnection(false)
+			if tt.initial != nil {
+				c.diffApplications(tt.initial)
+			}
+			got := c.diffApplications(tt.next)
+
+			sort.Slice(got, func(i, j int) bool { return got[i].SessionId < got[j].SessionId })
+			sort.Slice(tt.want, func(i, j int) bool { return tt.want[i].SessionId < tt.want[j].SessionId })
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffApplications() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package cast
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+
+	pb "github.com/vishen/go-chromecast/cast/proto"
+)
+
+const (
+	// minMetadataPollInterval floors how often a MetadataSource is polled,
+	// regardless of what the source itself suggests.
+	minMetadataPollInterval = 5 * time.Second
+
+	metadataPollBackoffStart = 5 * time.Second
+	metadataPollBackoffCap   = 60 * time.Second
+
+	metadataFetchTimeout = 30 * time.Second
+)
+
+// NowPlaying is the "now playing" info a MetadataSource reports for a live
+// stream, destined for MediaItem.Metadata.
+type NowPlaying struct {
+	Title    string
+	Artist   string
+	SongName string
+}
+
+// ApplyTo copies n onto item's displayed metadata.
+func (n NowPlaying) ApplyTo(item *MediaItem) {
+	item.Metadata.Title = n.Title
+	item.Metadata.Artist = n.Artist
+	item.Metadata.SongName = n.SongName
+}
+
+// MetadataSource fetches the current now-playing info for a live stream and
+// says how long the poller should wait before calling it again (e.g. the
+// ICY metadata chunk boundary, an HLS segment duration, or a JSON
+// endpoint's own advertised refresh interval).
+type MetadataSource interface {
+	Fetch(ctx context.Context) (NowPlaying, time.Duration, error)
+}
+
+// MetadataPoller repeatedly calls a MetadataSource and reports changes to
+// an OnUpdate callback, so a running session's displayed track info can be
+// kept current for streamType=LIVE items (internet radio, HLS, etc.) whose
+// MediaItem.Metadata was only ever correct at LOAD time.
+type MetadataPoller struct {
+	source MetadataSource
+
+	mu       sync.RWMutex
+	onUpdate func(NowPlaying)
+	last     NowPlaying
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+// NewMetadataPoller builds a poller over source. Call Start to begin
+// polling and Stop to tear it down.
+func NewMetadataPoller(source MetadataSource) *MetadataPoller {
+	return &MetadataPoller{
+		source:  source,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// OnUpdate registers the callback invoked whenever the source reports a
+// NowPlaying different from the last one observed.
+func (p *MetadataPoller) OnUpdate(fn func(NowPlaying)) {
+	p.mu.Lock()
+	p.onUpdate = fn
+	p.mu.Unlock()
+}
+
+// Start begins polling in the background.
+func (p *MetadataPoller) Start() {
+	go p.run()
+}
+
+// Stop ends polling; safe to call more than once. If the underlying
+// MetadataSource holds an open connection (e.g. IcyMetadataSource) and
+// implements io.Closer, it is closed too.
+func (p *MetadataPoller) Stop() {
+	p.closeOnce.Do(func() {
+		close(p.closeCh)
+		if closer, ok := p.source.(io.Closer); ok {
+			closer.Close()
+		}
+	})
+}
+
+func (p *MetadataPoller) run() {
+	backoff := metadataPollBackoffStart
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), metadataFetchTimeout)
+		now, next, err := p.source.Fetch(ctx)
+		cancel()
+
+		if err != nil {
+			if !p.sleep(backoff) {
+				return
+			}
+			backoff *= 2
+			if backoff > metadataPollBackoffCap {
+				backoff = metadataPollBackoffCap
+			}
+			continue
+		}
+		backoff = metadataPollBackoffStart
+
+		p.mu.Lock()
+		changed := now != p.last
+		p.last = now
+		onUpdate := p.onUpdate
+		p.mu.Unlock()
+
+		if changed && onUpdate != nil {
+			onUpdate(now)
+		}
+
+		if next < minMetadataPollInterval {
+			next = minMetadataPollInterval
+		}
+		if !p.sleep(next) {
+			return
+		}
+	}
+}
+
+func (p *MetadataPoller) sleep(d time.Duration) bool {
+	select {
+	case <-p.closeCh:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// IcyMetadataSource reads "now playing" info from an Icecast/Shoutcast
+// stream's inline ICY metadata, requested via the Icy-MetaData:1 header and
+// delivered every icy-metaint bytes of audio. The underlying HTTP stream is
+// opened once and kept across Fetch calls; a read failure closes it so the
+// next Fetch reopens from scratch.
+//
+// The request is made with a context owned by the source itself (created on
+// first use, canceled by Close), not the short-lived per-Fetch context a
+// caller passes in: http.NewRequestWithContext's context governs the
+// response body for its whole lifetime, so tying it to a per-poll timeout
+// would tear the "persistent" stream down the moment that poll's context is
+// canceled.
+type IcyMetadataSource struct {
+	URL    string
+	Client *http.Client
+
+	mu          sync.Mutex
+	ctx         context.Context
+	cancel      context.CancelFunc
+	body        io.ReadCloser
+	reader      *bufio.Reader
+	metaint     int
+	bitrateKbps int
+}
+
+func (s *IcyMetadataSource) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+func (s *IcyMetadataSource) ensureOpen() error {
+	if s.reader != nil {
+		return nil
+	}
+
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return errors.Wrap(err, "icy: unable to build request")
+	}
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return errors.Wrap(err, "icy: unable to open stream")
+	}
+
+	metaint, err := strconv.Atoi(resp.Header.Get("icy-metaint"))
+	if err != nil || metaint <= 0 {
+		resp.Body.Close()
+		return errors.New("icy: server did not return a usable icy-metaint")
+	}
+
+	s.body = resp.Body
+	s.reader = bufio.NewReader(resp.Body)
+	s.metaint = metaint
+	s.bitrateKbps, _ = strconv.Atoi(resp.Header.Get("icy-br"))
+	return nil
+}
+
+func (s *IcyMetadataSource) closeLocked() {
+	if s.body != nil {
+		s.body.Close()
+	}
+	s.body = nil
+	s.reader = nil
+}
+
+// Close ends the underlying stream, if open. It implements io.Closer so a
+// MetadataPoller calls it automatically from Stop.
+func (s *IcyMetadataSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.closeLocked()
+	return nil
+}
+
+// Fetch reads past one icy-metaint block of audio and returns the
+// StreamTitle found in the metadata block that follows, if any. ctx is
+// accepted to satisfy MetadataSource but deliberately not used to bound the
+// underlying stream; see the type doc comment.
+func (s *IcyMetadataSource) Fetch(ctx context.Context) (NowPlaying, time.Duration, error) {
+	_ = ctx
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ensureOpen(); err != nil {
+		return NowPlaying{}, 0, err
+	}
+
+	if _, err := io.CopyN(io.Discard, s.reader, int64(s.metaint)); err != nil {
+		s.closeLocked()
+		return NowPlaying{}, 0, errors.Wrap(err, "icy: unable to read audio block")
+	}
+
+	next := icyPollInterval(s.bitrateKbps, s.metaint)
+
+	lengthByte, err := s.reader.ReadByte()
+	if err != nil {
+		s.closeLocked()
+		return NowPlaying{}, 0, errors.Wrap(err, "icy: unable to read metadata length byte")
+	}
+	metaLen := int(lengthByte) * 16
+	if metaLen == 0 {
+		return NowPlaying{}, next, nil
+	}
+
+	meta := make([]byte, metaLen)
+	if _, err := io.ReadFull(s.reader, meta); err != nil {
+		s.closeLocked()
+		return NowPlaying{}, 0, errors.Wrap(err, "icy: unable to read metadata block")
+	}
+
+	return parseIcyStreamTitle(string(meta)), next, nil
+}
+
+func icyPollInterval(bitrateKbps, metaint int) time.Duration {
+	if bitrateKbps <= 0 {
+		return minMetadataPollInterval
+	}
+	bytesPerSecond := bitrateKbps * 1000 / 8
+	if bytesPerSecond <= 0 {
+		return minMetadataPollInterval
+	}
+	return time.Duration(metaint/bytesPerSecond) * time.Second
+}
+
+func parseIcyStreamTitle(meta string) NowPlaying {
+	meta = strings.TrimRight(meta, "\x00")
+	const marker = "StreamTitle='"
+	idx := strings.Index(meta, marker)
+	if idx == -1 {
+		return NowPlaying{}
+	}
+	rest := meta[idx+len(marker):]
+	end := strings.Index(rest, "';")
+	if end == -1 {
+		end = len(rest)
+	}
+	title := rest[:end]
+
+	if parts := strings.SplitN(title, " - ", 2); len(parts) == 2 {
+		return NowPlaying{Artist: parts[0], Title: parts[1], SongName: title}
+	}
+	return NowPlaying{Title: title, SongName: title}
+}
+
+// JSONMetadataSource polls a "now playing" JSON endpoint (e.g. a
+// station-specific service like the BBC's nowplaying poller) and extracts
+// title/artist/song name via jsonparser paths, along with an optional
+// server-advertised refresh interval (the BBC service's `timeout` field).
+type JSONMetadataSource struct {
+	URL    string
+	Client *http.Client
+
+	TitlePath    []string
+	ArtistPath   []string
+	SongNamePath []string
+	TimeoutPath  []string // seconds
+}
+
+func (s *JSONMetadataSource) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+func (s *JSONMetadataSource) Fetch(ctx context.Context) (NowPlaying, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return NowPlaying{}, 0, errors.Wrap(err, "json metadata: unable to build request")
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return NowPlaying{}, 0, errors.Wrap(err, "json metadata: unable to fetch")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return NowPlaying{}, 0, errors.Wrap(err, "json metadata: unable to read response")
+	}
+
+	now := NowPlaying{
+		Title:    jsonPathString(body, s.TitlePath),
+		Artist:   jsonPathString(body, s.ArtistPath),
+		SongName: jsonPathString(body, s.SongNamePath),
+	}
+	if now.SongName == "" {
+		now.SongName = now.Title
+	}
+
+	next := minMetadataPollInterval
+	if len(s.TimeoutPath) > 0 {
+		if timeout, err := jsonparser.GetInt(body, s.TimeoutPath...); err == nil && timeout > 0 {
+			next = time.Duration(timeout) * time.Second
+		}
+	}
+	return now, next, nil
+}
+
+// UpdateNowPlaying re-issues LOAD for a running live item with now's
+// title/artist/song name applied, which is how the Chromecast UI picks up
+// refreshed metadata for a stream whose MediaItem.Metadata was only ever
+// accurate at the original LOAD time. Wire a MetadataPoller's OnUpdate
+// callback to this to keep "now playing" current for internet radio.
+func (c *Connection) UpdateNowPlaying(ctx context.Context, sourceID, destinationID, namespace string, cmd LoadMediaCommand, now NowPlaying) (*pb.CastMessage, error) {
+	now.ApplyTo(&cmd.Media)
+	cmd.PayloadHeader = LoadHeader
+	cmd.Autoplay = true
+	return c.SendAndWait(ctx, &cmd, sourceID, destinationID, namespace)
+}
+
+func jsonPathString(body []byte, path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	v, err := jsonparser.GetString(body, path...)
+	if err != nil {
+		return ""
+	}
+	return v
+}
@@ -0,0 +1,92 @@
+package cast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseIcyStreamTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		meta string
+		want NowPlaying
+	}{
+		{
+			name: "artist and title",
+			meta: "StreamTitle='Artist Name - Track Title';StreamUrl='';",
+			want: NowPlaying{Artist: "Artist Name", Title: "Track Title", SongName: "Artist Name - Track Title"},
+		},
+		{
+			name: "title only, no separator",
+			meta: "StreamTitle='Just A Title';",
+			want: NowPlaying{Title: "Just A Title", SongName: "Just A Title"},
+		},
+		{
+			name: "no StreamTitle marker",
+			meta: "StreamUrl='https://example.com';",
+			want: NowPlaying{},
+		},
+		{
+			name: "padded with null bytes",
+			meta: "StreamTitle='Artist - Title';\x00\x00\x00",
+			want: NowPlaying{Artist: "Artist", Title: "Title", SongName: "Artist - Title"},
+		},
+		{
+			name: "empty",
+			meta: "",
+			want: NowPlaying{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseIcyStreamTitle(tt.meta)
+			if got != tt.want {
+				t.Errorf("parseIcyStreamTitle(%q) = %+v, want %+v", tt.meta, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIcyPollInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		bitrateKbps int
+		metaint     int
+		want        time.Duration
+	}{
+		{
+			name:        "unknown bitrate falls back to minimum",
+			bitrateKbps: 0,
+			metaint:     16000,
+			want:        minMetadataPollInterval,
+		},
+		{
+			name:        "negative bitrate falls back to minimum",
+			bitrateKbps: -1,
+			metaint:     16000,
+			want:        minMetadataPollInterval,
+		},
+		{
+			name:        "128kbps with a 16000 byte metaint",
+			bitrateKbps: 128,
+			metaint:     16000,
+			want:        time.Second, // 128000/8 = 16000 bytes/sec
+		},
+		{
+			name:        "64kbps with a 16000 byte metaint",
+			bitrateKbps: 64,
+			metaint:     16000,
+			want:        2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := icyPollInterval(tt.bitrateKbps, tt.metaint)
+			if got != tt.want {
+				t.Errorf("icyPollInterval(%d, %d) = %v, want %v", tt.bitrateKbps, tt.metaint, got, tt.want)
+			}
+		})
+	}
+}
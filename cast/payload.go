@@ -2,19 +2,31 @@ package cast
 
 var (
 	// Known Payload headers
-	ConnectHeader     = PayloadHeader{Type: "CONNECT"}
-	CloseHeader       = PayloadHeader{Type: "CLOSE"}
-	GetStatusHeader   = PayloadHeader{Type: "GET_STATUS"}
-	PongHeader        = PayloadHeader{Type: "PONG"}         // Response to PING payload
-	LaunchHeader      = PayloadHeader{Type: "LAUNCH"}       // Launches a new chromecast app
-	StopHeader        = PayloadHeader{Type: "STOP"}         // Stop playing current media
-	PlayHeader        = PayloadHeader{Type: "PLAY"}         // Plays / unpauses the running app
-	PauseHeader       = PayloadHeader{Type: "PAUSE"}        // Pauses the running app
-	SeekHeader        = PayloadHeader{Type: "SEEK"}         // Seek into the running app
-	VolumeHeader      = PayloadHeader{Type: "SET_VOLUME"}   // Sets the volume
-	LoadHeader        = PayloadHeader{Type: "LOAD"}         // Loads an application onto the chromecast
-	QueueLoadHeader   = PayloadHeader{Type: "QUEUE_LOAD"}   // Loads an application onto the chromecast
-	QueueUpdateHeader = PayloadHeader{Type: "QUEUE_UPDATE"} // Loads an application onto the chromecast
+	ConnectHeader      = PayloadHeader{Type: "CONNECT"}
+	CloseHeader        = PayloadHeader{Type: "CLOSE"}
+	GetStatusHeader    = PayloadHeader{Type: "GET_STATUS"}
+	PingHeader         = PayloadHeader{Type: "PING"}          // Heartbeat sent to keep the connection alive
+	PongHeader         = PayloadHeader{Type: "PONG"}          // Response to PING payload
+	LaunchHeader       = PayloadHeader{Type: "LAUNCH"}        // Launches a new chromecast app
+	StopHeader         = PayloadHeader{Type: "STOP"}          // Stop playing current media
+	PlayHeader         = PayloadHeader{Type: "PLAY"}          // Plays / unpauses the running app
+	PauseHeader        = PayloadHeader{Type: "PAUSE"}         // Pauses the running app
+	SeekHeader         = PayloadHeader{Type: "SEEK"}          // Seek into the running app
+	VolumeHeader       = PayloadHeader{Type: "SET_VOLUME"}    // Sets the volume
+	LoadHeader         = PayloadHeader{Type: "LOAD"}          // Loads an application onto the chromecast
+	QueueLoadHeader    = PayloadHeader{Type: "QUEUE_LOAD"}    // Replaces the queue with a new set of items
+	QueueInsertHeader  = PayloadHeader{Type: "QUEUE_INSERT"}  // Inserts items into the queue
+	QueueRemoveHeader  = PayloadHeader{Type: "QUEUE_REMOVE"}  // Removes items from the queue by item id
+	QueueReorderHeader = PayloadHeader{Type: "QUEUE_REORDER"} // Moves items within the queue
+	QueueUpdateHeader  = PayloadHeader{Type: "QUEUE_UPDATE"}  // Jumps to another item or changes repeat mode
+)
+
+// Repeat modes accepted by QueueUpdate.RepeatMode / QueueLoad.RepeatMode.
+const (
+	RepeatModeOff           = "REPEAT_OFF"
+	RepeatModeAll           = "REPEAT_ALL"
+	RepeatModeSingle        = "REPEAT_SINGLE"
+	RepeatModeAllAndShuffle = "REPEAT_ALL_AND_SHUFFLE"
 )
 
 type Payload interface {
@@ -32,8 +44,9 @@ func (p *PayloadHeader) SetRequestId(id int) {
 
 type QueueUpdate struct {
 	PayloadHeader
-	MediaSessionId int `json:"mediaSessionId,omitempty"`
-	Jump           int `json:"jump,omitempty"`
+	MediaSessionId int    `json:"mediaSessionId,omitempty"`
+	Jump           int    `json:"jump,omitempty"`
+	RepeatMode     string `json:"repeatMode,omitempty"`
 }
 
 type QueueLoad struct {
@@ -45,7 +58,33 @@ type QueueLoad struct {
 	Items          []QueueLoadItem `json:"items"`
 }
 
+// QueueInsert adds Items to the queue, placed just before the item whose id
+// is InsertBefore (appended to the end when omitted).
+type QueueInsert struct {
+	PayloadHeader
+	MediaSessionId int             `json:"mediaSessionId,omitempty"`
+	Items          []QueueLoadItem `json:"items"`
+	InsertBefore   int             `json:"insertBefore,omitempty"`
+}
+
+// QueueRemove drops the items in ItemIds from the queue.
+type QueueRemove struct {
+	PayloadHeader
+	MediaSessionId int   `json:"mediaSessionId,omitempty"`
+	ItemIds        []int `json:"itemIds"`
+}
+
+// QueueReorder moves the items in ItemIds so they sit just before the item
+// whose id is InsertBefore (moved to the end when omitted).
+type QueueReorder struct {
+	PayloadHeader
+	MediaSessionId int   `json:"mediaSessionId,omitempty"`
+	ItemIds        []int `json:"itemIds"`
+	InsertBefore   int   `json:"insertBefore,omitempty"`
+}
+
 type QueueLoadItem struct {
+	ItemId           int       `json:"itemId,omitempty"`
 	Media            MediaItem `json:"media"`
 	Autoplay         bool      `json:"autoplay"`
 	PlaybackDuration int       `json:"playbackDuration"`
@@ -117,6 +156,16 @@ type MediaItem struct {
 		SongName     string `json:"songName"`
 		Artist       string `json:"artist"`
 	} `json:"metadata"`
+
+	// ReplayGain carries the track/album loudness tags this item was
+	// normalized against, if any. See Connection.LoadMedia.
+	ReplayGain *ReplayGainTags `json:"replayGain,omitempty"`
+}
+
+// VolumeRequest is the SET_VOLUME command payload.
+type VolumeRequest struct {
+	PayloadHeader
+	Volume Volume `json:"volume"`
 }
 
 type Media struct {
@@ -127,6 +176,12 @@ type Media struct {
 	Volume         Volume  `json:"volume"`
 
 	Media MediaItem `json:"media"`
+
+	// Present on queue-aware sessions: the full ordered queue and the item
+	// id currently playing.
+	Items         []QueueLoadItem `json:"items,omitempty"`
+	CurrentItemId int             `json:"currentItemId,omitempty"`
+	RepeatMode    string          `json:"repeatMode,omitempty"`
 }
 
 type MediaStatusResponse struct {
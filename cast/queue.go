@@ -0,0 +1,266 @@
+package cast
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// QueueItemChangeFunc is invoked whenever the currently-playing queue item
+// changes, whether from Next/Prev or the receiver advancing on its own.
+type QueueItemChangeFunc func(item QueueLoadItem, index int)
+
+// Queue is a thin client over the Chromecast media queue protocol
+// (QUEUE_LOAD/QUEUE_INSERT/QUEUE_REMOVE/QUEUE_REORDER/QUEUE_UPDATE), layered
+// over a Connection the same way the rest of cast's commands are built on
+// top of Send/SendAndWait rather than owning their own socket.
+type Queue struct {
+	conn *Connection
+
+	sourceID      string
+	destinationID string
+	namespace     string
+
+	mediaSessionID int
+
+	mu           sync.RWMutex
+	items        []QueueLoadItem
+	currentIndex int
+	repeatMode   string
+
+	onItemChange QueueItemChangeFunc
+
+	listenerHandle ListenerHandle
+}
+
+// NewQueue builds a Queue that issues its commands over conn, addressed from
+// sourceID to destinationID on namespace (typically the media namespace of
+// the session whose receiver app owns the queue). It also subscribes to
+// unsolicited MEDIA_STATUS broadcasts on the media namespace (regardless of
+// namespace) via conn.OnMediaStatus, so
+// OnItemChange fires when the receiver advances the queue on its own, not
+// just in reply to Queue's own commands. Call Close to unsubscribe.
+func NewQueue(conn *Connection, sourceID, destinationID, namespace string) *Queue {
+	q := &Queue{
+		conn:          conn,
+		sourceID:      sourceID,
+		destinationID: destinationID,
+		namespace:     namespace,
+		currentIndex:  -1,
+	}
+	q.listenerHandle = conn.OnMediaStatus(func(status Media) {
+		q.mu.RLock()
+		sessionID := q.mediaSessionID
+		q.mu.RUnlock()
+		if sessionID != 0 && status.MediaSessionId != sessionID {
+			return
+		}
+		q.applyStatus(&MediaStatusResponse{Status: []Media{status}})
+	})
+	return q
+}
+
+// Close unsubscribes the Queue from MEDIA_STATUS broadcasts. It does not
+// affect the underlying Connection.
+func (q *Queue) Close() {
+	q.conn.RemoveListener(q.listenerHandle)
+}
+
+// SetMediaSessionId tells the Queue which mediaSessionId to stamp on
+// subsequent commands; it's normally learned from the LOAD/QUEUE_LOAD reply.
+func (q *Queue) SetMediaSessionId(id int) {
+	q.mu.Lock()
+	q.mediaSessionID = id
+	q.mu.Unlock()
+}
+
+// OnItemChange registers a callback fired whenever the currently-playing
+// queue item changes.
+func (q *Queue) OnItemChange(fn QueueItemChangeFunc) {
+	q.mu.Lock()
+	q.onItemChange = fn
+	q.mu.Unlock()
+}
+
+// Snapshot returns the queue's current ordered items and the index of the
+// item currently playing (-1 if unknown).
+func (q *Queue) Snapshot() ([]QueueLoadItem, int) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	items := make([]QueueLoadItem, len(q.items))
+	copy(items, q.items)
+	return items, q.currentIndex
+}
+
+// Load replaces the queue with items, starting playback at startIndex under
+// repeatMode (one of the RepeatMode* constants).
+func (q *Queue) Load(ctx context.Context, items []QueueLoadItem, startIndex int, repeatMode string) error {
+	q.mu.RLock()
+	sessionID := q.mediaSessionID
+	q.mu.RUnlock()
+
+	resp, err := q.sendAndWait(ctx, &QueueLoad{
+		PayloadHeader:  QueueLoadHeader,
+		MediaSessionId: sessionID,
+		StartIndex:     startIndex,
+		RepeatMode:     repeatMode,
+		Items:          items,
+	})
+	if err != nil {
+		return err
+	}
+	return q.applyStatus(resp)
+}
+
+// Insert adds items to the queue, placed just before the item whose id is
+// insertBeforeItemId (appended to the end when insertBeforeItemId is 0).
+func (q *Queue) Insert(ctx context.Context, items []QueueLoadItem, insertBeforeItemId int) error {
+	q.mu.RLock()
+	sessionID := q.mediaSessionID
+	q.mu.RUnlock()
+
+	resp, err := q.sendAndWait(ctx, &QueueInsert{
+		PayloadHeader:  QueueInsertHeader,
+		MediaSessionId: sessionID,
+		Items:          items,
+		InsertBefore:   insertBeforeItemId,
+	})
+	if err != nil {
+		return err
+	}
+	return q.applyStatus(resp)
+}
+
+// Remove drops the items in itemIds from the queue.
+func (q *Queue) Remove(ctx context.Context, itemIds []int) error {
+	q.mu.RLock()
+	sessionID := q.mediaSessionID
+	q.mu.RUnlock()
+
+	resp, err := q.sendAndWait(ctx, &QueueRemove{
+		PayloadHeader:  QueueRemoveHeader,
+		MediaSessionId: sessionID,
+		ItemIds:        itemIds,
+	})
+	if err != nil {
+		return err
+	}
+	return q.applyStatus(resp)
+}
+
+// Reorder moves the items in itemIds so they sit just before the item whose
+// id is insertBeforeItemId (moved to the end when insertBeforeItemId is 0).
+func (q *Queue) Reorder(ctx context.Context, itemIds []int, insertBeforeItemId int) error {
+	q.mu.RLock()
+	sessionID := q.mediaSessionID
+	q.mu.RUnlock()
+
+	resp, err := q.sendAndWait(ctx, &QueueReorder{
+		PayloadHeader:  QueueReorderHeader,
+		MediaSessionId: sessionID,
+		ItemIds:        itemIds,
+		InsertBefore:   insertBeforeItemId,
+	})
+	if err != nil {
+		return err
+	}
+	return q.applyStatus(resp)
+}
+
+// Next jumps to the following queue item.
+func (q *Queue) Next(ctx context.Context) error {
+	return q.jump(ctx, 1)
+}
+
+// Prev jumps to the preceding queue item.
+func (q *Queue) Prev(ctx context.Context) error {
+	return q.jump(ctx, -1)
+}
+
+func (q *Queue) jump(ctx context.Context, jump int) error {
+	q.mu.RLock()
+	sessionID := q.mediaSessionID
+	q.mu.RUnlock()
+
+	resp, err := q.sendAndWait(ctx, &QueueUpdate{
+		PayloadHeader:  QueueUpdateHeader,
+		MediaSessionId: sessionID,
+		Jump:           jump,
+	})
+	if err != nil {
+		return err
+	}
+	return q.applyStatus(resp)
+}
+
+// SetRepeatMode transitions the queue's repeat mode (one of the RepeatMode*
+// constants).
+func (q *Queue) SetRepeatMode(ctx context.Context, repeatMode string) error {
+	q.mu.RLock()
+	sessionID := q.mediaSessionID
+	q.mu.RUnlock()
+
+	resp, err := q.sendAndWait(ctx, &QueueUpdate{
+		PayloadHeader:  QueueUpdateHeader,
+		MediaSessionId: sessionID,
+		RepeatMode:     repeatMode,
+	})
+	if err != nil {
+		return err
+	}
+	return q.applyStatus(resp)
+}
+
+func (q *Queue) sendAndWait(ctx context.Context, payload Payload) (*MediaStatusResponse, error) {
+	message, err := q.conn.SendAndWait(ctx, payload, q.sourceID, q.destinationID, q.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp MediaStatusResponse
+	if err := json.Unmarshal([]byte(*message.PayloadUtf8), &resp); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal queue status response")
+	}
+	return &resp, nil
+}
+
+// applyStatus updates the Queue's view of the world from a MEDIA_STATUS
+// reply and fires OnItemChange if the currently-playing item moved.
+func (q *Queue) applyStatus(resp *MediaStatusResponse) error {
+	if len(resp.Status) == 0 {
+		return nil
+	}
+	status := resp.Status[0]
+
+	q.mu.Lock()
+	q.mediaSessionID = status.MediaSessionId
+	if status.RepeatMode != "" {
+		q.repeatMode = status.RepeatMode
+	}
+	if status.Items != nil {
+		q.items = status.Items
+	}
+
+	newIndex := q.currentIndex
+	for i, item := range q.items {
+		if item.ItemId == status.CurrentItemId {
+			newIndex = i
+			break
+		}
+	}
+	changed := newIndex != q.currentIndex
+	q.currentIndex = newIndex
+	var changedItem QueueLoadItem
+	if changed && newIndex >= 0 && newIndex < len(q.items) {
+		changedItem = q.items[newIndex]
+	}
+	onItemChange := q.onItemChange
+	q.mu.Unlock()
+
+	if changed && onItemChange != nil {
+		onItemChange(changedItem, newIndex)
+	}
+	return nil
+}
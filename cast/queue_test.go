@@ -0,0 +1,86 @@
+package cast
+
+import "testing"
+
+func TestQueueApplyStatus(t *testing.T) {
+	item1 := QueueLoadItem{ItemId: 1}
+	item2 := QueueLoadItem{ItemId: 2}
+
+	t.Run("empty status is a no-op", func(t *testing.T) {
+		q := NewQueue(NewConnection(false), "src", "dst", namespaceMedia)
+		var fired bool
+		q.OnItemChange(func(QueueLoadItem, int) { fired = true })
+
+		if err := q.applyStatus(&MediaStatusResponse{}); err != nil {
+			t.Fatalf("applyStatus() error = %v", err)
+		}
+		if fired {
+			t.Errorf("OnItemChange fired on an empty status")
+		}
+	})
+
+	t.Run("first status sets items and fires on the current item", func(t *testing.T) {
+		q := NewQueue(NewConnection(false), "src", "dst", namespaceMedia)
+		var gotItem QueueLoadItem
+		var gotIndex int
+		q.OnItemChange(func(item QueueLoadItem, index int) {
+			gotItem, gotIndex = item, index
+		})
+
+		err := q.applyStatus(&MediaStatusResponse{Status: []Media{{
+			MediaSessionId: 42,
+			Items:          []QueueLoadItem{item1, item2},
+			CurrentItemId:  2,
+			RepeatMode:     RepeatModeAll,
+		}}})
+		if err != nil {
+			t.Fatalf("applyStatus() error = %v", err)
+		}
+
+		items, index := q.Snapshot()
+		if len(items) != 2 || index != 1 {
+			t.Fatalf("Snapshot() = %+v, %d; want 2 items, index 1", items, index)
+		}
+		if gotItem != item2 || gotIndex != 1 {
+			t.Errorf("OnItemChange called with %+v, %d; want %+v, 1", gotItem, gotIndex, item2)
+		}
+	})
+
+	t.Run("receiver auto-advancing fires OnItemChange again", func(t *testing.T) {
+		q := NewQueue(NewConnection(false), "src", "dst", namespaceMedia)
+		var calls int
+		q.OnItemChange(func(QueueLoadItem, int) { calls++ })
+
+		status := Media{MediaSessionId: 42, Items: []QueueLoadItem{item1, item2}, CurrentItemId: 1}
+		if err := q.applyStatus(&MediaStatusResponse{Status: []Media{status}}); err != nil {
+			t.Fatalf("applyStatus() error = %v", err)
+		}
+		if calls != 1 {
+			t.Fatalf("calls after first status = %d, want 1", calls)
+		}
+
+		// The receiver broadcasts that it advanced on its own, without any
+		// Queue-initiated command in between.
+		status.CurrentItemId = 2
+		if err := q.applyStatus(&MediaStatusResponse{Status: []Media{status}}); err != nil {
+			t.Fatalf("applyStatus() error = %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("calls after receiver-driven advance = %d, want 2", calls)
+		}
+	})
+
+	t.Run("re-sending the same current item does not re-fire", func(t *testing.T) {
+		q := NewQueue(NewConnection(false), "src", "dst", namespaceMedia)
+		var calls int
+		q.OnItemChange(func(QueueLoadItem, int) { calls++ })
+
+		status := Media{MediaSessionId: 42, Items: []QueueLoadItem{item1, item2}, CurrentItemId: 1}
+		q.applyStatus(&MediaStatusResponse{Status: []Media{status}})
+		q.applyStatus(&MediaStatusResponse{Status: []Media{status}})
+
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+}
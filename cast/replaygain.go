@@ -0,0 +1,173 @@
+package cast
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"github.com/pkg/errors"
+
+	pb "github.com/vishen/go-chromecast/cast/proto"
+)
+
+// ReplayGainMode selects which ReplayGain tag pair (if any) LoadMedia
+// normalizes playback volume against.
+type ReplayGainMode int
+
+const (
+	// ReplayGainNone issues LOAD without touching the volume.
+	ReplayGainNone ReplayGainMode = iota
+	// ReplayGainTrack normalizes against the per-track gain/peak tags.
+	ReplayGainTrack
+	// ReplayGainAlbum normalizes against the per-album gain/peak tags.
+	ReplayGainAlbum
+)
+
+const (
+	// replayGainReferenceDB is the loudness level ReplayGain tags are
+	// computed against by taggers (roughly 89dB SPL).
+	replayGainReferenceDB = -18.0
+
+	// defaultReplayGainTargetDB is used when no target has been set; left
+	// equal to replayGainReferenceDB it reproduces the tags as authored,
+	// landing close to the -14 LUFS-ish loudness most streaming services
+	// target.
+	defaultReplayGainTargetDB = replayGainReferenceDB
+
+	// defaultFallbackVolume is used when normalization is enabled but the
+	// item carries no usable ReplayGain tags.
+	defaultFallbackVolume float32 = 1.0
+)
+
+// ReplayGainTags are the loudness values read from a file's ID3/FLAC/Vorbis
+// replaygain_* comments.
+type ReplayGainTags struct {
+	TrackGain float64 `json:"trackGain,omitempty"` // dB
+	TrackPeak float64 `json:"trackPeak,omitempty"` // linear, 0..1
+	AlbumGain float64 `json:"albumGain,omitempty"` // dB
+	AlbumPeak float64 `json:"albumPeak,omitempty"` // linear, 0..1
+}
+
+// ReadReplayGainTags extracts ReplayGain tags from file metadata parsed by
+// github.com/dhowden/tag, using whichever of the standard replaygain_*
+// comment keys the format exposes.
+func ReadReplayGainTags(m tag.Metadata) ReplayGainTags {
+	raw := m.Raw()
+	return ReplayGainTags{
+		TrackGain: parseGainDB(raw["replaygain_track_gain"]),
+		TrackPeak: parsePeak(raw["replaygain_track_peak"]),
+		AlbumGain: parseGainDB(raw["replaygain_album_gain"]),
+		AlbumPeak: parsePeak(raw["replaygain_album_peak"]),
+	}
+}
+
+func parseGainDB(v interface{}) float64 {
+	s := strings.TrimSpace(tagValueToString(v))
+	s = strings.TrimSpace(strings.TrimSuffix(s, "dB"))
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func parsePeak(v interface{}) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(tagValueToString(v)), 64)
+	return f
+}
+
+func tagValueToString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return ""
+	}
+}
+
+// SetReplayGainMode sets which tag pair LoadMedia normalizes against by
+// default; LoadMediaOptions.ReplayGainMode overrides it per call.
+func (c *Connection) SetReplayGainMode(mode ReplayGainMode) { c.replayGainMode = mode }
+
+// SetReplayGainTargetDB changes the target loudness LoadMedia normalizes
+// to, relative to the reference level ReplayGain tags are authored against
+// (default defaultReplayGainTargetDB).
+func (c *Connection) SetReplayGainTargetDB(db float64) { c.replayGainTargetDB = db }
+
+// replayGainVolume computes the SET_VOLUME level (0.0-1.0) for tags under
+// mode at targetDB, clamped by peak so normalization never clips, falling
+// back to fallbackVolume when the requested tag pair is missing entirely.
+func replayGainVolume(tags ReplayGainTags, mode ReplayGainMode, targetDB float64, fallbackVolume float32) float32 {
+	var gain, peak float64
+	switch mode {
+	case ReplayGainTrack:
+		gain, peak = tags.TrackGain, tags.TrackPeak
+	case ReplayGainAlbum:
+		gain, peak = tags.AlbumGain, tags.AlbumPeak
+	default:
+		return fallbackVolume
+	}
+
+	if gain == 0 && peak == 0 {
+		return fallbackVolume
+	}
+
+	preamp := targetDB - replayGainReferenceDB
+	factor := math.Pow(10, (gain+preamp)/20)
+	if peak > 0 {
+		if max := 1 / peak; factor > max {
+			factor = max
+		}
+	}
+	if factor > 1 {
+		factor = 1
+	} else if factor < 0 {
+		factor = 0
+	}
+	return float32(factor)
+}
+
+// LoadMediaOptions configures per-item ReplayGain behaviour for LoadMedia.
+type LoadMediaOptions struct {
+	// ReplayGainMode overrides the Connection's default normalization mode
+	// for this item; nil inherits the Connection's mode.
+	ReplayGainMode *ReplayGainMode
+	// ReplayGainTags are the tags read from the item's file, if any.
+	ReplayGainTags ReplayGainTags
+	// FallbackVolume is used when normalization is enabled but
+	// ReplayGainTags is empty. Defaults to defaultFallbackVolume.
+	FallbackVolume float32
+}
+
+// LoadMedia issues a LOAD for cmd, first applying ReplayGain-based volume
+// normalization (per the Connection's default mode, or opts.ReplayGainMode
+// if set) via a SET_VOLUME sent just before the LOAD.
+func (c *Connection) LoadMedia(ctx context.Context, sourceID, destinationID, namespace string, cmd LoadMediaCommand, opts LoadMediaOptions) (*pb.CastMessage, error) {
+	mode := c.replayGainMode
+	if opts.ReplayGainMode != nil {
+		mode = *opts.ReplayGainMode
+	}
+
+	if mode != ReplayGainNone {
+		fallback := opts.FallbackVolume
+		if fallback == 0 {
+			fallback = defaultFallbackVolume
+		}
+		level := replayGainVolume(opts.ReplayGainTags, mode, c.replayGainTargetDB, fallback)
+
+		tags := opts.ReplayGainTags
+		cmd.Media.ReplayGain = &tags
+		if cmd.CustomData == nil {
+			cmd.CustomData = map[string]interface{}{"replayGain": tags}
+		}
+
+		if _, err := c.Send(&VolumeRequest{PayloadHeader: VolumeHeader, Volume: Volume{Level: level}}, sourceID, destinationID, namespace); err != nil {
+			return nil, errors.Wrap(err, "unable to set replaygain volume before LOAD")
+		}
+	}
+
+	cmd.PayloadHeader = LoadHeader
+	return c.SendAndWait(ctx, &cmd, sourceID, destinationID, namespace)
+}
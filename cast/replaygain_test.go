@@ -0,0 +1,75 @@
+package cast
+
+import "testing"
+
+func TestReplayGainVolume(t *testing.T) {
+	tests := []struct {
+		name           string
+		tags           ReplayGainTags
+		mode           ReplayGainMode
+		targetDB       float64
+		fallbackVolume float32
+		want           float32
+	}{
+		{
+			name:           "mode none returns fallback",
+			tags:           ReplayGainTags{TrackGain: -6, TrackPeak: 0.5},
+			mode:           ReplayGainNone,
+			targetDB:       replayGainReferenceDB,
+			fallbackVolume: 0.8,
+			want:           0.8,
+		},
+		{
+			name:           "track mode with no tags returns fallback",
+			tags:           ReplayGainTags{},
+			mode:           ReplayGainTrack,
+			targetDB:       replayGainReferenceDB,
+			fallbackVolume: 1.0,
+			want:           1.0,
+		},
+		{
+			name:           "track mode at reference level is unity",
+			tags:           ReplayGainTags{TrackGain: 0, TrackPeak: 0.5},
+			mode:           ReplayGainTrack,
+			targetDB:       replayGainReferenceDB,
+			fallbackVolume: 1.0,
+			want:           1.0,
+		},
+		{
+			// SET_VOLUME.level is documented 0.0-1.0, so even though the raw
+			// peak clamp (1/peak) alone would allow ~1.11 here, the final
+			// [0,1] clamp is what actually bounds it for any peak <= 1.
+			name:           "positive gain is clamped to 1, not the raw peak ratio",
+			tags:           ReplayGainTags{TrackGain: 6, TrackPeak: 0.9},
+			mode:           ReplayGainTrack,
+			targetDB:       replayGainReferenceDB,
+			fallbackVolume: 1.0,
+			want:           1.0,
+		},
+		{
+			name:           "album mode reduces volume for negative gain",
+			tags:           ReplayGainTags{AlbumGain: -6, AlbumPeak: 0.5},
+			mode:           ReplayGainAlbum,
+			targetDB:       replayGainReferenceDB,
+			fallbackVolume: 1.0,
+			want:           0.5011872,
+		},
+		{
+			name:           "result never exceeds 1",
+			tags:           ReplayGainTags{TrackGain: 20, TrackPeak: 0},
+			mode:           ReplayGainTrack,
+			targetDB:       replayGainReferenceDB,
+			fallbackVolume: 1.0,
+			want:           1.0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := replayGainVolume(tt.tags, tt.mode, tt.targetDB, tt.fallbackVolume)
+			if diff := got - tt.want; diff > 0.001 || diff < -0.001 {
+				t.Errorf("replayGainVolume() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}